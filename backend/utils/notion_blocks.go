@@ -0,0 +1,274 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/jomei/notionapi"
+
+	"github.com/chaitin/panda-wiki/log"
+)
+
+// AssetUploader rehosts a Notion-hosted file (whose URL is a short-lived,
+// pre-signed S3 link) through the wiki's own storage/upload subsystem and
+// returns a stable, public URL for it.
+type AssetUploader interface {
+	Upload(ctx context.Context, filename string, r io.Reader) (url string, err error)
+}
+
+// renderContext carries positional information a block needs to render
+// correctly that isn't present on the block itself, so getBlock can compute
+// it once from a parent's already-fetched children instead of each item
+// making its own lookup call.
+type renderContext struct {
+	// numberedListIndex is this block's 1-based position within its run of
+	// consecutive numbered_list_item siblings. Zero outside such a run.
+	numberedListIndex int
+}
+
+// groupListSiblings walks a parent's children in order and assigns each one
+// a renderContext, grouping consecutive numbered_list_item blocks into a
+// single numbered run so their indices stay correct and O(1) per item even
+// when non-list blocks are interleaved or the children span pagination
+// boundaries (getChildren already returns the full, paginated list). It
+// takes just the children's types rather than the blocks themselves, since
+// that's all it needs.
+func groupListSiblings(childTypes []notionapi.BlockType) []renderContext {
+	rcs := make([]renderContext, len(childTypes))
+	numbered := 0
+	for i, t := range childTypes {
+		if t == notionapi.BlockTypeNumberedListItem {
+			numbered++
+			rcs[i] = renderContext{numberedListIndex: numbered}
+			continue
+		}
+		numbered = 0
+	}
+	return rcs
+}
+
+// BlockToMarkdown renders a single Notion block to markdown. It does not
+// recurse into the block's children - getBlock handles that, indenting each
+// child's rendered markdown beneath its parent. The exception is a table
+// block, whose rows it fetches and renders itself (see selfManagesChildren).
+func (c *NotionClient) BlockToMarkdown(ctx context.Context, block notionapi.Block, rc renderContext) string {
+	switch block.GetType() {
+	case notionapi.BlockTypeHeading1:
+		return fmt.Sprintf("# %s\n", c.richTextToMarkdown(block.(*notionapi.Heading1Block).Heading1.RichText))
+	case notionapi.BlockTypeParagraph:
+		return fmt.Sprintf("%s\n", c.richTextToMarkdown(block.(*notionapi.ParagraphBlock).Paragraph.RichText))
+	case notionapi.BlockTypeHeading2:
+		return fmt.Sprintf("## %s\n", c.richTextToMarkdown(block.(*notionapi.Heading2Block).Heading2.RichText))
+	case notionapi.BlockTypeHeading3:
+		return fmt.Sprintf("### %s\n", c.richTextToMarkdown(block.(*notionapi.Heading3Block).Heading3.RichText))
+	case notionapi.BlockTypeBulletedListItem:
+		return fmt.Sprintf("- %s\n", c.richTextToMarkdown(block.(*notionapi.BulletedListItemBlock).BulletedListItem.RichText))
+	case notionapi.BlockTypeNumberedListItem:
+		return fmt.Sprintf("%d. %s\n", rc.numberedListIndex, c.richTextToMarkdown(block.(*notionapi.NumberedListItemBlock).NumberedListItem.RichText))
+	case notionapi.BlockTypeToggle:
+		// closing ":::" isn't written here - it has to come after the
+		// toggle's children, which getBlock appends once this returns.
+		return fmt.Sprintf("::: toggle\n%s\n", c.richTextToMarkdown(block.(*notionapi.ToggleBlock).Toggle.RichText))
+	case notionapi.BlockTypeQuote:
+		return fmt.Sprintf("> %s\n", c.richTextToMarkdown(block.(*notionapi.QuoteBlock).Quote.RichText))
+	case notionapi.BlockTypeCode:
+		return fmt.Sprintf("```\n%s\n```\n", plainText(block.(*notionapi.CodeBlock).Code.RichText))
+	case notionapi.BlockTypeCallout:
+		return fmt.Sprintf("⚠️ %s\n", c.richTextToMarkdown(block.(*notionapi.CalloutBlock).Callout.RichText))
+	case notionapi.BlockTypeToDo:
+		todo := block.(*notionapi.ToDoBlock).ToDo
+		if todo.Checked {
+			return fmt.Sprintf("- [x] %s\n", c.richTextToMarkdown(todo.RichText))
+		}
+		return fmt.Sprintf("- [ ] %s\n", c.richTextToMarkdown(todo.RichText))
+	case notionapi.BlockTypeDivider:
+		return "---\n"
+	case notionapi.BlockTypeBreadcrumb:
+		return ""
+	case notionapi.BlockTypeTableOfContents:
+		return "[[toc]]\n"
+	case notionapi.BlockTypeEquation:
+		return fmt.Sprintf("$$%s$$\n", block.(*notionapi.EquationBlock).Equation.Expression)
+	case notionapi.BlockTypeChildPage:
+		return fmt.Sprintf("- [%s](%s)\n", block.(*notionapi.ChildPageBlock).ChildPage.Title, block.GetID().String())
+	case notionapi.BlockTypeChildDatabase:
+		return fmt.Sprintf("- [%s](%s)\n", block.(*notionapi.ChildDatabaseBlock).ChildDatabase.Title, block.GetID().String())
+	case notionapi.BlockTypeBookmark:
+		bm := block.(*notionapi.BookmarkBlock).Bookmark
+		label := c.richTextToMarkdown(bm.Caption)
+		if label == "" {
+			label = bm.URL
+		}
+		return fmt.Sprintf("[%s](%s)\n", label, bm.URL)
+	case notionapi.BlockTypeLinkPreview:
+		link := block.(*notionapi.LinkPreviewBlock).LinkPreview.URL
+		return fmt.Sprintf("[%s](%s)\n", link, link)
+	case notionapi.BlockTypeEmbed:
+		embed := block.(*notionapi.EmbedBlock).Embed
+		label := c.richTextToMarkdown(embed.Caption)
+		if label == "" {
+			label = embed.URL
+		}
+		return fmt.Sprintf("[%s](%s)\n", label, embed.URL)
+	case notionapi.BlockTypeColumnList, notionapi.BlockTypeColumn, notionapi.BlockTypeSyncedBlock:
+		// layout-only blocks: their markdown is entirely their children's,
+		// rendered and indented by getBlock.
+		return ""
+	case notionapi.BlockTypeImage:
+		img := block.(*notionapi.ImageBlock).Image
+		alt := c.richTextToMarkdown(img.Caption)
+		assetURL := c.rehostAsset(ctx, block.GetID().String(), string(img.Type), img.File, img.External)
+		return fmt.Sprintf("![%s](%s)\n", alt, assetURL)
+	case notionapi.BlockTypeVideo:
+		video := block.(*notionapi.VideoBlock).Video
+		assetURL := c.rehostAsset(ctx, block.GetID().String(), string(video.Type), video.File, video.External)
+		return fmt.Sprintf("<video src=\"%s\" controls></video>\n", assetURL)
+	// audio blocks aren't handled: the vendored notionapi's decodeBlock has no
+	// case for the "audio" block type, so it comes back as a zero-valued
+	// UnsupportedBlock rather than *notionapi.AudioBlock - there's no type to
+	// switch on here until the SDK adds support.
+	case notionapi.BlockTypePdf:
+		pdf := block.(*notionapi.PdfBlock).Pdf
+		assetURL := c.rehostAsset(ctx, block.GetID().String(), string(pdf.Type), pdf.File, pdf.External)
+		label := c.richTextToMarkdown(pdf.Caption)
+		if label == "" {
+			label = path.Base(assetURL)
+		}
+		return fmt.Sprintf("[%s](%s)\n", label, assetURL)
+	case notionapi.BlockTypeFile:
+		file := block.(*notionapi.FileBlock).File
+		assetURL := c.rehostAsset(ctx, block.GetID().String(), string(file.Type), file.File, file.External)
+		label := c.richTextToMarkdown(file.Caption)
+		if label == "" {
+			label = path.Base(assetURL)
+		}
+		return fmt.Sprintf("[%s](%s)\n", label, assetURL)
+	case notionapi.BlockTypeTableRowBlock:
+		cells := block.(*notionapi.TableRowBlock).TableRow.Cells
+		nums := len(cells)
+		buf := strings.Builder{}
+		buf.WriteString("| ")
+		for i := 0; i < nums; i++ {
+			buf.WriteString(c.richTextToMarkdown(cells[i]))
+			if i != nums-1 {
+				buf.WriteString(" | ")
+			}
+		}
+		buf.WriteString(" |\n")
+		return buf.String()
+	case notionapi.BlockTypeTableBlock:
+		// rows are rendered directly rather than through getBlock, so a row
+		// with its own children (a sub-block nested in a cell, rare but
+		// possible via the API) won't have that content fetched/rendered.
+		rows, err := c.getChildren(ctx, block.GetID().String())
+		if err != nil {
+			c.logger.Error("get table rows error", log.String("block_id", block.GetID().String()), log.Error(err))
+			return ""
+		}
+		hasRow := block.(*notionapi.TableBlock).Table.HasRowHeader
+		var res strings.Builder
+		for i, row := range rows {
+			res.WriteString(c.BlockToMarkdown(ctx, row, renderContext{}))
+			if i == 0 && hasRow {
+				cols := len(row.(*notionapi.TableRowBlock).TableRow.Cells) + 1
+				for j := 0; j < cols; j++ {
+					res.WriteString("| ---")
+				}
+				res.WriteString("|\n")
+			}
+		}
+		return res.String()
+	default:
+		return ""
+	}
+}
+
+// selfManagesChildren reports whether a block type's own BlockToMarkdown
+// case already fetches and renders its children itself, so getBlock's
+// generic child-recursion must be skipped to avoid rendering them twice.
+func selfManagesChildren(t notionapi.BlockType) bool {
+	return t == notionapi.BlockTypeTableBlock
+}
+
+// plainText concatenates a run of rich text into plain text, ignoring
+// inline formatting. Used for code blocks (where markdown emphasis would be
+// taken literally) and frontmatter values (which are plain YAML scalars).
+func plainText(rt []notionapi.RichText) string {
+	var buf strings.Builder
+	for _, r := range rt {
+		buf.WriteString(r.PlainText)
+	}
+	return buf.String()
+}
+
+// rehostAsset downloads a Notion-hosted file (the `file` variant, whose URL
+// expires) through the configured AssetUploader and returns the rehosted
+// URL. `external` assets are not Notion-hosted and are linked as-is. If no
+// uploader is configured, or the download/upload fails, it falls back to the
+// URL Notion returned so the import doesn't fail outright.
+func (c *NotionClient) rehostAsset(ctx context.Context, blockID, assetType string, file, external *notionapi.FileObject) string {
+	if assetType != "file" || file == nil {
+		if external != nil {
+			return external.URL
+		}
+		return ""
+	}
+	if c.uploader == nil {
+		return file.URL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, file.URL, nil)
+	if err != nil {
+		c.logger.Error("build notion asset download request failed", log.String("block_id", blockID), log.Error(err))
+		return file.URL
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.logger.Error("download notion asset failed", log.String("block_id", blockID), log.Error(err))
+		return file.URL
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		c.logger.Error("download notion asset failed", log.String("block_id", blockID), log.String("status", resp.Status))
+		return file.URL
+	}
+
+	rehosted, err := c.uploader.Upload(ctx, assetFilename(blockID, file.URL), resp.Body)
+	if err != nil {
+		c.logger.Error("upload notion asset failed", log.String("block_id", blockID), log.Error(err))
+		return file.URL
+	}
+	return rehosted
+}
+
+func assetFilename(blockID, rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		if ext := path.Ext(u.Path); ext != "" {
+			return blockID + ext
+		}
+	}
+	return blockID
+}
+
+// indentMarkdown indents every line of a rendered child block by two spaces
+// so nested content (toggle/callout children, column layouts, sub-lists)
+// reads as markdown under its parent instead of being flattened.
+func indentMarkdown(b []byte) []byte {
+	text := strings.TrimRight(string(b), "\n")
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(text, "\n")
+	var out strings.Builder
+	for _, line := range lines {
+		out.WriteString("  ")
+		out.WriteString(line)
+		out.WriteString("\n")
+	}
+	return []byte(out.String())
+}
@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jomei/notionapi"
+)
+
+func TestGroupListSiblings(t *testing.T) {
+	cases := []struct {
+		name  string
+		types []notionapi.BlockType
+		want  []renderContext
+	}{
+		{
+			name:  "no siblings",
+			types: nil,
+			want:  []renderContext{},
+		},
+		{
+			name:  "single numbered run",
+			types: []notionapi.BlockType{notionapi.BlockTypeNumberedListItem, notionapi.BlockTypeNumberedListItem, notionapi.BlockTypeNumberedListItem},
+			want: []renderContext{
+				{numberedListIndex: 1},
+				{numberedListIndex: 2},
+				{numberedListIndex: 3},
+			},
+		},
+		{
+			name:  "run restarts after a non-list block",
+			types: []notionapi.BlockType{notionapi.BlockTypeNumberedListItem, notionapi.BlockTypeNumberedListItem, notionapi.BlockTypeParagraph, notionapi.BlockTypeNumberedListItem},
+			want: []renderContext{
+				{numberedListIndex: 1},
+				{numberedListIndex: 2},
+				{},
+				{numberedListIndex: 1},
+			},
+		},
+		{
+			name:  "non-numbered blocks are untouched",
+			types: []notionapi.BlockType{notionapi.BlockTypeParagraph, notionapi.BlockTypeBulletedListItem},
+			want:  []renderContext{{}, {}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := groupListSiblings(tc.types)
+			if len(tc.types) == 0 {
+				if len(got) != 0 {
+					t.Fatalf("got %+v, want empty", got)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("got %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSelfManagesChildren(t *testing.T) {
+	if !selfManagesChildren(notionapi.BlockTypeTableBlock) {
+		t.Error("table blocks should self-manage children (BlockToMarkdown already renders rows)")
+	}
+	if selfManagesChildren(notionapi.BlockTypeToggle) {
+		t.Error("toggle blocks rely on getBlock's generic recursion and should not self-manage children")
+	}
+	if selfManagesChildren(notionapi.BlockTypeParagraph) {
+		t.Error("paragraph blocks should not self-manage children")
+	}
+}
+
+func TestPlainText(t *testing.T) {
+	rt := []notionapi.RichText{
+		{PlainText: "hello "},
+		{PlainText: "world"},
+	}
+	if got, want := plainText(rt), "hello world"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAssetFilename(t *testing.T) {
+	cases := []struct {
+		name     string
+		blockID  string
+		rawURL   string
+		expected string
+	}{
+		{"with extension", "block-1", "https://s3.example.com/path/to/file.png?sig=abc", "block-1.png"},
+		{"without extension", "block-2", "https://s3.example.com/path/to/file", "block-2"},
+		{"unparseable url", "block-3", "://not a url", "block-3"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := assetFilename(tc.blockID, tc.rawURL); got != tc.expected {
+				t.Errorf("got %q, want %q", got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestIndentMarkdown(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "", ""},
+		{"single line", "hello\n", "  hello\n"},
+		{"multiple lines", "a\nb\n", "  a\n  b\n"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := string(indentMarkdown([]byte(tc.in))); got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
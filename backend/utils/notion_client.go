@@ -2,112 +2,175 @@ package utils
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
-	"strings"
+	"sync"
 
 	"github.com/jomei/notionapi"
+	"golang.org/x/time/rate"
 
 	"github.com/chaitin/panda-wiki/domain"
 	"github.com/chaitin/panda-wiki/log"
 )
 
-// Block represents a Notion block
-type ImageBlock struct {
-	Object      string `json:"object"`
-	ID          string `json:"id"`
-	ParentID    string `json:"parent_id"`
-	HasChildren bool   `json:"has_children"`
-	Type        string `json:"type"`
-	Image       Image  `json:"image"`
+type NotionClient struct {
+	token  string
+	client *notionapi.Client
+	logger *log.Logger
+
+	limiter      *rate.Limiter
+	sem          semaphore
+	maxRetries   int
+	uploader     AssetUploader
+	slugResolver PageSlugResolver
 }
 
-// Image represents an image block in Notion
-type Image struct {
-	Caption []interface{} `json:"caption"`
-	Type    string        `json:"type"`
-	File    File          `json:"file"`
+// NotionClientOption configures the pagination/rate-limit/concurrency knobs
+// of a NotionClient. Sensible defaults are applied when none are given.
+type NotionClientOption func(*NotionClient)
+
+// WithRPS caps outgoing Notion API requests to rps per second, matching
+// Notion's documented 3 requests/sec limit by default.
+func WithRPS(rps float64) NotionClientOption {
+	return func(c *NotionClient) {
+		c.limiter = rate.NewLimiter(rate.Limit(rps), 1)
+	}
 }
 
-// File represents the file details of an image block
-type File struct {
-	URL string `json:"url"`
+// WithConcurrency bounds how many Notion API calls may be in flight at once.
+// Page and block fetches each run in their own goroutine and are not counted
+// against it; only the API calls they make are.
+func WithConcurrency(n int) NotionClientOption {
+	return func(c *NotionClient) {
+		c.sem = newSemaphore(n)
+	}
 }
 
-type NotionClient struct {
-	token  string
-	client *notionapi.Client
-	logger *log.Logger
+// WithMaxRetries bounds how many times a rate-limited (HTTP 429) request is
+// retried before giving up.
+func WithMaxRetries(n int) NotionClientOption {
+	return func(c *NotionClient) {
+		c.maxRetries = n
+	}
+}
+
+// WithAssetUploader rehosts Notion-hosted files (images, video, pdf, generic
+// files; audio blocks are not rendered, so not rehosted) through the wiki's own storage/upload subsystem instead of
+// linking the expiring S3 URL Notion returns.
+func WithAssetUploader(uploader AssetUploader) NotionClientOption {
+	return func(c *NotionClient) {
+		c.uploader = uploader
+	}
 }
 
-func NewNotionClient(token string, logger *log.Logger) *NotionClient {
-	return &NotionClient{
-		token:  token,
-		logger: logger.WithModule("usecase.NotionClient"),
-		client: notionapi.NewClient(notionapi.Token(token)),
+func NewNotionClient(token string, logger *log.Logger, opts ...NotionClientOption) *NotionClient {
+	c := &NotionClient{
+		token:      token,
+		logger:     logger.WithModule("usecase.NotionClient"),
+		limiter:    rate.NewLimiter(rate.Limit(defaultNotionRPS), 1),
+		sem:        newSemaphore(defaultNotionConcurrent),
+		maxRetries: defaultNotionMaxRetries,
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	// built after options are applied so WithMaxRetries governs the client's
+	// own Retry-After-aware retry behavior on HTTP 429s.
+	c.client = notionapi.NewClient(notionapi.Token(token), notionapi.WithRetry(c.maxRetries))
+	return c
 }
 
 // titleContain 表示按标题搜索含有titleContain的页面
 func (c *NotionClient) GetList(ctx context.Context, titleContain string) ([]domain.PageInfo, error) {
-	res, err := c.client.Search.Do(ctx, &notionapi.SearchRequest{
-		Query: titleContain,
-		Filter: notionapi.SearchFilter{
-			Property: "object",
-			Value:    "page",
-		},
-	})
-	if err != nil {
-		return nil, err
-	}
 	var result []domain.PageInfo
-	for _, page := range res.Results {
-		var id, title string
-		switch page.GetObject().String() {
-		case "page":
-			page := page.(*notionapi.Page)
-			id = page.ID.String()
-			if titleProp, ok := page.Properties["title"].(*notionapi.TitleProperty); ok {
-
-				if len(titleProp.Title) > 0 {
-					title = titleProp.Title[0].PlainText
-				}
-			} else if titleProp, ok := page.Properties["Name"].(*notionapi.TitleProperty); ok {
-				if len(titleProp.Title) > 0 {
-					title = titleProp.Title[0].PlainText
+	cursor := notionapi.Cursor("")
+	for {
+		req := &notionapi.SearchRequest{
+			Query: titleContain,
+			Filter: notionapi.SearchFilter{
+				Property: "object",
+				Value:    "page",
+			},
+			StartCursor: cursor,
+		}
+		var res *notionapi.SearchResponse
+		if err := c.withRateLimit(ctx, func() error {
+			var doErr error
+			res, doErr = c.client.Search.Do(ctx, req)
+			return doErr
+		}); err != nil {
+			return nil, err
+		}
+		for _, page := range res.Results {
+			var id, title string
+			switch page.GetObject().String() {
+			case "page":
+				page := page.(*notionapi.Page)
+				id = page.ID.String()
+				if titleProp, ok := page.Properties["title"].(*notionapi.TitleProperty); ok {
+
+					if len(titleProp.Title) > 0 {
+						title = titleProp.Title[0].PlainText
+					}
+				} else if titleProp, ok := page.Properties["Name"].(*notionapi.TitleProperty); ok {
+					if len(titleProp.Title) > 0 {
+						title = titleProp.Title[0].PlainText
+					}
 				}
+			case "block":
+				id = page.(notionapi.Block).GetID().String()
+			case "database":
+				id = page.(*notionapi.Database).ID.String()
+			default:
+			}
+			if title != "" {
+				result = append(result, domain.PageInfo{
+					Id:    id,
+					Title: title,
+				})
 			}
-		case "block":
-			id = page.(notionapi.Block).GetID().String()
-		case "database":
-			id = page.(*notionapi.Database).ID.String()
-		default:
 		}
-		if title != "" {
-			result = append(result, domain.PageInfo{
-				Id:    id,
-				Title: title,
-			})
+		if !res.HasMore || res.NextCursor == "" {
+			break
 		}
+		cursor = res.NextCursor
 	}
 	return result, nil
 }
 
-func (c *NotionClient) GetPagesContent(Pages []domain.PageInfo) ([]domain.Page, error) {
-	var result []domain.Page
-	for _, page := range Pages {
-		res, err := c.getPageContent(page)
+// GetPagesContent fetches every page's content concurrently, one goroutine
+// per page, so large batches are imported in parallel instead of serially.
+// The goroutines themselves are not bounded; the outgoing Notion requests
+// they make are capped by the client's shared rate limiter and concurrency
+// semaphore.
+func (c *NotionClient) GetPagesContent(ctx context.Context, Pages []domain.PageInfo) ([]domain.Page, error) {
+	result := make([]domain.Page, len(Pages))
+	errs := make([]error, len(Pages))
+
+	var wg sync.WaitGroup
+	for i, page := range Pages {
+		wg.Add(1)
+		go func(i int, page domain.PageInfo) {
+			defer wg.Done()
+			res, err := c.getPageContent(ctx, page)
+			if err != nil {
+				errs[i] = fmt.Errorf("get Pages %s error: %s", page.Id, err.Error())
+				return
+			}
+			result[i] = *res
+		}(i, page)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
 		if err != nil {
-			return nil, fmt.Errorf("get Pages %s error: %s", page.Id, err.Error())
+			return nil, err
 		}
-		result = append(result, *res)
 	}
 	return result, nil
 }
 
-func (c *NotionClient) getPageContent(Page domain.PageInfo) (*domain.Page, error) {
-	buf, err := c.getBlock(Page.Id)
+func (c *NotionClient) getPageContent(ctx context.Context, Page domain.PageInfo) (*domain.Page, error) {
+	buf, err := c.getBlock(ctx, Page.Id, renderContext{})
 	if err != nil {
 		return nil, fmt.Errorf("get Page %s error: %s", Page.Id, err.Error())
 	}
@@ -118,39 +181,97 @@ func (c *NotionClient) getPageContent(Page domain.PageInfo) (*domain.Page, error
 		Content: string(buf),
 	}, nil
 }
-func (c *NotionClient) getBlock(id string) ([]byte, error) {
-	var result []byte
-	b, err := c.client.Block.Get(context.Background(), notionapi.BlockID(id))
 
-	if err != nil {
+func (c *NotionClient) getBlock(ctx context.Context, id string, rc renderContext) ([]byte, error) {
+	var b notionapi.Block
+	if err := c.withRateLimit(ctx, func() error {
+		var doErr error
+		b, doErr = c.client.Block.Get(ctx, notionapi.BlockID(id))
+		return doErr
+	}); err != nil {
 		c.logger.Error("get block error", log.String("block_id", id), log.Error(err))
 		return []byte{}, fmt.Errorf("get block %s error: %s", id, err.Error())
 	}
-	if b.GetType() == notionapi.BlockType(notionapi.BlockTypeUnsupported) {
-		c.logger.Error("get block error", log.String("block_id", id), log.Error(err), log.String("block_type", b.GetType().String()))
+	// an empty Type means decodeBlock didn't recognize this block's Notion
+	// type string at all (e.g. "audio", which the vendored SDK has no case
+	// for) and returned a zero-valued UnsupportedBlock without unmarshaling
+	// - that's distinct from, but just as unrenderable as, BlockTypeUnsupported.
+	if t := b.GetType(); t == notionapi.BlockTypeUnsupported || t == "" {
+		c.logger.Error("skipping block notion/SDK can't decode", log.String("block_id", id), log.String("block_type", t.String()))
 		return []byte{}, nil
 	}
 	c.logger.Info("block", log.String("block_id", id), log.String("block_type", b.GetType().String()))
 
-	if !b.GetHasChildren() {
-		return []byte(c.BlockToMarkdown(b)), nil
+	own := c.BlockToMarkdown(ctx, b, rc)
+	blockType := b.GetType()
+	if !b.GetHasChildren() || selfManagesChildren(blockType) {
+		if blockType == notionapi.BlockTypeToggle {
+			own += ":::\n"
+		}
+		return []byte(own), nil
 	}
 
-	childerns, err := c.client.Block.GetChildren(context.Background(), notionapi.BlockID(id), &notionapi.Pagination{})
+	children, err := c.getChildren(ctx, id)
 	if err != nil {
 		c.logger.Error("get block's children error", log.String("block_id", id), log.Error(err))
 		return []byte{}, fmt.Errorf("get block's children %s error: %s", id, err.Error())
 	}
-	for _, childern := range childerns.Results {
-
-		Id := childern.GetID().String()
+	childTypes := make([]notionapi.BlockType, len(children))
+	for i, child := range children {
+		childTypes[i] = child.GetType()
+	}
+	childContexts := groupListSiblings(childTypes)
+
+	bufs := make([][]byte, len(children))
+	var wg sync.WaitGroup
+	for i, child := range children {
+		wg.Add(1)
+		go func(i int, childID string, childRC renderContext) {
+			defer wg.Done()
+			buf, err := c.getBlock(ctx, childID, childRC)
+			if err != nil {
+				c.logger.Error("get block child error", log.String("block_id", childID), log.Error(err))
+				return
+			}
+			bufs[i] = indentMarkdown(buf)
+		}(i, child.GetID().String(), childContexts[i])
+	}
+	wg.Wait()
 
-		buf, err := c.getBlock(Id)
-		if err != nil {
-			c.logger.Error("get block child error", log.String("block_id", Id), log.Error(err))
-		}
+	result := []byte(own)
+	for _, buf := range bufs {
 		result = append(result, buf...)
+	}
+	if blockType == notionapi.BlockTypeToggle {
+		// own's opening "::: toggle" fence only closes once children, which
+		// belong inside it, have been appended.
+		result = append(result, []byte(":::\n")...)
+	}
+	return result, nil
+}
 
+// getChildren pages through all of a block's children, following
+// NextCursor/HasMore so blocks with more than Notion's default 100-item
+// page size are fetched in full.
+func (c *NotionClient) getChildren(ctx context.Context, id string) ([]notionapi.Block, error) {
+	var result []notionapi.Block
+	cursor := notionapi.Cursor("")
+	for {
+		var res *notionapi.GetChildrenResponse
+		if err := c.withRateLimit(ctx, func() error {
+			var doErr error
+			res, doErr = c.client.Block.GetChildren(ctx, notionapi.BlockID(id), &notionapi.Pagination{StartCursor: cursor})
+			return doErr
+		}); err != nil {
+			return nil, err
+		}
+		result = append(result, res.Results...)
+		if !res.HasMore || res.NextCursor == "" {
+			break
+		}
+		// unlike Search/Database.Query, GetChildrenResponse.NextCursor is a
+		// plain string rather than a notionapi.Cursor.
+		cursor = notionapi.Cursor(res.NextCursor)
 	}
 	return result, nil
 }
@@ -167,131 +288,3 @@ func (c *NotionClient) GetPages(req []domain.PageInfo) ([]*notionapi.Page, error
 	}
 	return result, nil
 }
-
-func (c *NotionClient) BlockToMarkdown(block notionapi.Block) string {
-	switch block.GetType() {
-	case notionapi.BlockTypeHeading1:
-		return fmt.Sprintf("# %s\n", block.GetRichTextString())
-	case notionapi.BlockTypeParagraph:
-		return fmt.Sprintf("%s\n", block.GetRichTextString())
-	case notionapi.BlockTypeHeading2:
-		return fmt.Sprintf("## %s\n", block.GetRichTextString())
-	case notionapi.BlockTypeHeading3:
-		return fmt.Sprintf("### %s\n", block.GetRichTextString())
-	case notionapi.BlockTypeBulletedListItem:
-		return fmt.Sprintf("- %s\n", block.GetRichTextString())
-	case notionapi.BlockTypeNumberedListItem:
-		num := c.getNumberedListNumber(block)
-		return fmt.Sprintf("%d. %s\n", num, block.GetRichTextString())
-	case notionapi.BlockTypeToggle:
-		return fmt.Sprintf("::: toggle\n%s\n:::\n", block.GetRichTextString())
-	case notionapi.BlockTypeQuote:
-		return fmt.Sprintf("> %s\n", block.GetRichTextString())
-	case notionapi.BlockTypeCode:
-
-		return fmt.Sprintf("```\n%s\n```\n", block.GetRichTextString())
-	case notionapi.BlockTypeTableRowBlock:
-
-		cells := block.(*notionapi.TableRowBlock).TableRow.Cells
-		nums := len(cells)
-		buf := strings.Builder{}
-		buf.WriteString("| ")
-		for i := 0; i < nums; i++ {
-			if len(cells[i]) > 0 {
-				buf.WriteString(cells[i][0].PlainText)
-			}
-			if i != nums-1 {
-				buf.WriteString(" | ")
-			}
-		}
-		buf.WriteString(" |\n")
-		return buf.String()
-
-	case notionapi.BlockTypeTableBlock:
-		ch, _ := c.client.Block.GetChildren(context.Background(), notionapi.BlockID(block.GetID().String()), &notionapi.Pagination{})
-		hasRow := block.(*notionapi.TableBlock).Table.HasRowHeader
-		var res strings.Builder
-
-		for i, temp := range ch.Results {
-
-			res.Write([]byte(c.BlockToMarkdown(temp)))
-			if i == 0 && hasRow {
-				len := len(temp.(*notionapi.TableRowBlock).TableRow.Cells) + 1
-
-				for j := 0; j < len; j++ {
-					res.Write([]byte("| ---"))
-				}
-				res.Write([]byte("|\n"))
-			}
-		}
-		return res.String()
-
-	case notionapi.BlockTypeDivider:
-		return "---\n"
-	case notionapi.BlockTypeVideo:
-		url := block.(*notionapi.AudioBlock).Audio.GetURL()
-		return fmt.Sprintf("<iframe src=\"%s\" width=\"300\" height=\"200\" frameborder=\"0\" allowfullscreen></iframe>", url)
-	case notionapi.BlockTypeEmbed:
-		url := block.(notionapi.EmbedBlock).Embed.URL
-		return fmt.Sprintf("{%s}", url)
-	case notionapi.BlockTypeCallout:
-		return fmt.Sprintf("⚠️ %s\n", block.GetRichTextString())
-	case notionapi.BlockTypeToDo:
-		if block.(*notionapi.ToDoBlock).ToDo.Checked {
-			return fmt.Sprintf("- [x] %s\n", block.GetRichTextString())
-		}
-		return fmt.Sprintf("- [ ] %s\n", block.GetRichTextString())
-	case notionapi.BlockTypeImage:
-		url, err := c.getImageURL(block)
-		if err != nil {
-			return err.Error()
-		}
-		return fmt.Sprintf("![%s](%s)\n", "", url)
-	default:
-		return ""
-	}
-}
-func (c *NotionClient) getImageURL(block notionapi.Block) (string, error) {
-	url := "https://api.notion.com/v1/blocks/" + block.GetID().String()
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Add("Authorization", "Bearer "+c.token)
-	req.Header.Add("Notion-Version", "2021-08-16")
-	req.Header.Add("Content-Type", "application/json")
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-	var data ImageBlock
-	err = json.NewDecoder(resp.Body).Decode(&data)
-	if err != nil {
-		return "", err
-	}
-	return data.Image.File.URL, nil
-
-}
-
-// 获取当前ListBlock的序号
-func (c *NotionClient) getNumberedListNumber(block notionapi.Block) int {
-
-	parentId := block.GetParent().BlockID.String()
-	children, err := c.client.Block.GetChildren(context.Background(), notionapi.BlockID(parentId), &notionapi.Pagination{})
-	if err != nil {
-		return 1
-	}
-	i := 0
-	for _, child := range children.Results {
-
-		if child.GetID().String() == block.GetID().String() {
-			return i + 1
-		}
-		if child.GetType() == notionapi.BlockTypeNumberedListItem {
-			i++
-		}
-	}
-	return i
-}
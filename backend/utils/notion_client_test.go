@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/jomei/notionapi"
+	"golang.org/x/time/rate"
+)
+
+// fakeSearchService overrides only the methods a test needs; embedding the
+// interface satisfies the rest without having to stub every method of
+// notionapi.SearchService.
+type fakeSearchService struct {
+	notionapi.SearchService
+	do func(ctx context.Context, req *notionapi.SearchRequest) (*notionapi.SearchResponse, error)
+}
+
+func (f fakeSearchService) Do(ctx context.Context, req *notionapi.SearchRequest) (*notionapi.SearchResponse, error) {
+	return f.do(ctx, req)
+}
+
+// fakeBlockService overrides only GetChildren; see fakeSearchService.
+type fakeBlockService struct {
+	notionapi.BlockService
+	getChildren func(ctx context.Context, id notionapi.BlockID, pagination *notionapi.Pagination) (*notionapi.GetChildrenResponse, error)
+}
+
+func (f fakeBlockService) GetChildren(ctx context.Context, id notionapi.BlockID, pagination *notionapi.Pagination) (*notionapi.GetChildrenResponse, error) {
+	return f.getChildren(ctx, id, pagination)
+}
+
+func newTestClient() *NotionClient {
+	return &NotionClient{
+		limiter: rate.NewLimiter(rate.Inf, 1),
+		sem:     newSemaphore(1),
+	}
+}
+
+func TestGetListPagination(t *testing.T) {
+	responses := []*notionapi.SearchResponse{
+		{HasMore: true, NextCursor: notionapi.Cursor("cursor-1")},
+		{HasMore: false, NextCursor: ""},
+	}
+	var gotCursors []notionapi.Cursor
+	call := 0
+	c := newTestClient()
+	c.client = &notionapi.Client{Search: fakeSearchService{do: func(ctx context.Context, req *notionapi.SearchRequest) (*notionapi.SearchResponse, error) {
+		gotCursors = append(gotCursors, req.StartCursor)
+		res := responses[call]
+		call++
+		return res, nil
+	}}}
+
+	if _, err := c.GetList(context.Background(), "q"); err != nil {
+		t.Fatalf("GetList error: %v", err)
+	}
+	if call != len(responses) {
+		t.Fatalf("expected %d Search.Do calls, got %d", len(responses), call)
+	}
+	want := []notionapi.Cursor{"", "cursor-1"}
+	if !reflect.DeepEqual(gotCursors, want) {
+		t.Errorf("got cursors %+v, want %+v", gotCursors, want)
+	}
+}
+
+func TestGetChildrenPagination(t *testing.T) {
+	pages := [][]notionapi.Block{
+		{&notionapi.ParagraphBlock{}, &notionapi.ParagraphBlock{}},
+		{&notionapi.ParagraphBlock{}},
+	}
+	responses := []*notionapi.GetChildrenResponse{
+		{Results: pages[0], HasMore: true, NextCursor: "cursor-1"},
+		{Results: pages[1], HasMore: false, NextCursor: ""},
+	}
+	var gotCursors []notionapi.Cursor
+	call := 0
+	c := newTestClient()
+	c.client = &notionapi.Client{Block: fakeBlockService{getChildren: func(ctx context.Context, id notionapi.BlockID, pagination *notionapi.Pagination) (*notionapi.GetChildrenResponse, error) {
+		gotCursors = append(gotCursors, pagination.StartCursor)
+		res := responses[call]
+		call++
+		return res, nil
+	}}}
+
+	got, err := c.getChildren(context.Background(), "parent-id")
+	if err != nil {
+		t.Fatalf("getChildren error: %v", err)
+	}
+	if len(got) != len(pages[0])+len(pages[1]) {
+		t.Fatalf("expected %d blocks across both pages, got %d", len(pages[0])+len(pages[1]), len(got))
+	}
+	// GetChildrenResponse.NextCursor is a plain string - it must be converted
+	// to notionapi.Cursor before being threaded into the next page's request.
+	want := []notionapi.Cursor{"", notionapi.Cursor("cursor-1")}
+	if !reflect.DeepEqual(gotCursors, want) {
+		t.Errorf("got cursors %+v, want %+v", gotCursors, want)
+	}
+}
@@ -0,0 +1,226 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jomei/notionapi"
+	"gopkg.in/yaml.v3"
+
+	"github.com/chaitin/panda-wiki/domain"
+	"github.com/chaitin/panda-wiki/log"
+)
+
+// GetDatabases searches for databases the integration can see, following the
+// same titleContain convention as GetList but filtering Search to "database"
+// objects instead of "page" ones.
+func (c *NotionClient) GetDatabases(ctx context.Context, titleContain string) ([]domain.PageInfo, error) {
+	var result []domain.PageInfo
+	cursor := notionapi.Cursor("")
+	for {
+		req := &notionapi.SearchRequest{
+			Query: titleContain,
+			Filter: notionapi.SearchFilter{
+				Property: "object",
+				Value:    "database",
+			},
+			StartCursor: cursor,
+		}
+		var res *notionapi.SearchResponse
+		if err := c.withRateLimit(ctx, func() error {
+			var doErr error
+			res, doErr = c.client.Search.Do(ctx, req)
+			return doErr
+		}); err != nil {
+			return nil, err
+		}
+		for _, r := range res.Results {
+			db, ok := r.(*notionapi.Database)
+			if !ok {
+				continue
+			}
+			result = append(result, domain.PageInfo{
+				Id:    db.ID.String(),
+				Title: plainText(db.Title),
+			})
+		}
+		if !res.HasMore || res.NextCursor == "" {
+			break
+		}
+		cursor = res.NextCursor
+	}
+	return result, nil
+}
+
+// QueryDatabase runs a Notion database query starting at cursor and pages
+// through the rest of the results, converting every row into a domain.Page
+// whose content is the row's own block content with its properties
+// prepended as YAML frontmatter. Callers wire this up behind GetDatabases so
+// a user can pick a database and import it as one page per row.
+func (c *NotionClient) QueryDatabase(ctx context.Context, id string, filter notionapi.Filter, sorts []notionapi.SortObject, cursor notionapi.Cursor) ([]domain.Page, error) {
+	var result []domain.Page
+	for {
+		req := &notionapi.DatabaseQueryRequest{
+			Filter:      filter,
+			Sorts:       sorts,
+			StartCursor: cursor,
+		}
+		var res *notionapi.DatabaseQueryResponse
+		if err := c.withRateLimit(ctx, func() error {
+			var doErr error
+			res, doErr = c.client.Database.Query(ctx, notionapi.DatabaseID(id), req)
+			return doErr
+		}); err != nil {
+			return nil, err
+		}
+		for _, row := range res.Results {
+			page, err := c.databaseRowToPage(ctx, &row)
+			if err != nil {
+				c.logger.Error("convert database row failed", log.String("page_id", row.ID.String()), log.Error(err))
+				continue
+			}
+			result = append(result, *page)
+		}
+		if !res.HasMore || res.NextCursor == "" {
+			break
+		}
+		cursor = res.NextCursor
+	}
+	return result, nil
+}
+
+func (c *NotionClient) databaseRowToPage(ctx context.Context, row *notionapi.Page) (*domain.Page, error) {
+	content, err := c.getBlock(ctx, row.ID.String(), renderContext{})
+	if err != nil {
+		return nil, fmt.Errorf("get database row %s error: %s", row.ID.String(), err.Error())
+	}
+
+	frontmatter, err := yaml.Marshal(propertiesToFrontmatter(row.Properties))
+	if err != nil {
+		return nil, fmt.Errorf("marshal database row %s frontmatter: %s", row.ID.String(), err.Error())
+	}
+
+	var buf strings.Builder
+	buf.WriteString("---\n")
+	buf.Write(frontmatter)
+	buf.WriteString("---\n\n")
+	buf.Write(content)
+
+	return &domain.Page{
+		ID:      row.ID.String(),
+		Title:   rowTitle(row.Properties),
+		Content: buf.String(),
+	}, nil
+}
+
+func rowTitle(props notionapi.Properties) string {
+	for _, name := range []string{"title", "Name"} {
+		if tp, ok := props[name].(*notionapi.TitleProperty); ok && len(tp.Title) > 0 {
+			return plainText(tp.Title)
+		}
+	}
+	return ""
+}
+
+// propertiesToFrontmatter converts a database row's properties into a
+// YAML-frontmatter-ready map, keeping only the property types that carry a
+// renderable scalar/list value.
+func propertiesToFrontmatter(props notionapi.Properties) map[string]interface{} {
+	fm := make(map[string]interface{}, len(props))
+	for name, prop := range props {
+		if v, ok := propertyValue(prop); ok {
+			fm[name] = v
+		}
+	}
+	return fm
+}
+
+func propertyValue(prop notionapi.Property) (interface{}, bool) {
+	switch p := prop.(type) {
+	case *notionapi.TitleProperty:
+		return plainText(p.Title), true
+	case *notionapi.RichTextProperty:
+		return plainText(p.RichText), true
+	case *notionapi.SelectProperty:
+		if p.Select.Name == "" {
+			return nil, false
+		}
+		return p.Select.Name, true
+	case *notionapi.MultiSelectProperty:
+		names := make([]string, len(p.MultiSelect))
+		for i, opt := range p.MultiSelect {
+			names[i] = opt.Name
+		}
+		return names, true
+	case *notionapi.DateProperty:
+		if p.Date == nil {
+			return nil, false
+		}
+		if p.Date.End != nil {
+			return fmt.Sprintf("%s/%s", p.Date.Start, p.Date.End), true
+		}
+		return fmt.Sprintf("%s", p.Date.Start), true
+	case *notionapi.NumberProperty:
+		return p.Number, true
+	case *notionapi.CheckboxProperty:
+		return p.Checkbox, true
+	case *notionapi.URLProperty:
+		return p.URL, true
+	case *notionapi.EmailProperty:
+		return p.Email, true
+	case *notionapi.PeopleProperty:
+		names := make([]string, 0, len(p.People))
+		for _, person := range p.People {
+			names = append(names, person.Name)
+		}
+		return names, true
+	case *notionapi.RelationProperty:
+		ids := make([]string, len(p.Relation))
+		for i, rel := range p.Relation {
+			ids[i] = rel.ID.String()
+		}
+		return ids, true
+	case *notionapi.FormulaProperty:
+		return formulaValue(p.Formula)
+	case *notionapi.RollupProperty:
+		return rollupValue(p.Rollup)
+	default:
+		return nil, false
+	}
+}
+
+func formulaValue(f notionapi.Formula) (interface{}, bool) {
+	switch f.Type {
+	case "string":
+		return f.String, true
+	case "number":
+		return f.Number, true
+	case "boolean":
+		return f.Boolean, true
+	case "date":
+		if f.Date == nil {
+			return nil, false
+		}
+		return fmt.Sprintf("%s", f.Date.Start), true
+	default:
+		return nil, false
+	}
+}
+
+func rollupValue(r notionapi.Rollup) (interface{}, bool) {
+	switch r.Type {
+	case "number":
+		return r.Number, true
+	case "array":
+		vals := make([]interface{}, 0, len(r.Array))
+		for _, prop := range r.Array {
+			if v, ok := propertyValue(prop); ok {
+				vals = append(vals, v)
+			}
+		}
+		return vals, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jomei/notionapi"
+)
+
+func TestPropertyValue(t *testing.T) {
+	cases := []struct {
+		name    string
+		prop    notionapi.Property
+		wantOK  bool
+		wantVal interface{}
+	}{
+		{
+			name:    "title",
+			prop:    &notionapi.TitleProperty{Title: []notionapi.RichText{{PlainText: "Hello"}}},
+			wantOK:  true,
+			wantVal: "Hello",
+		},
+		{
+			name:    "rich text",
+			prop:    &notionapi.RichTextProperty{RichText: []notionapi.RichText{{PlainText: "Body"}}},
+			wantOK:  true,
+			wantVal: "Body",
+		},
+		{
+			name:    "select with value",
+			prop:    func() notionapi.Property { p := &notionapi.SelectProperty{}; p.Select.Name = "Done"; return p }(),
+			wantOK:  true,
+			wantVal: "Done",
+		},
+		{
+			name:   "select without value",
+			prop:   &notionapi.SelectProperty{},
+			wantOK: false,
+		},
+		{
+			name:    "multi-select with no options",
+			prop:    &notionapi.MultiSelectProperty{},
+			wantOK:  true,
+			wantVal: []string{},
+		},
+		{
+			name:   "date without value",
+			prop:   &notionapi.DateProperty{},
+			wantOK: false,
+		},
+		{
+			name:    "number",
+			prop:    &notionapi.NumberProperty{Number: 42},
+			wantOK:  true,
+			wantVal: float64(42),
+		},
+		{
+			name:    "checkbox",
+			prop:    &notionapi.CheckboxProperty{Checkbox: true},
+			wantOK:  true,
+			wantVal: true,
+		},
+		{
+			name:    "url",
+			prop:    &notionapi.URLProperty{URL: "https://example.com"},
+			wantOK:  true,
+			wantVal: "https://example.com",
+		},
+		{
+			name:    "email",
+			prop:    &notionapi.EmailProperty{Email: "a@example.com"},
+			wantOK:  true,
+			wantVal: "a@example.com",
+		},
+		{
+			name:    "people with no people",
+			prop:    &notionapi.PeopleProperty{},
+			wantOK:  true,
+			wantVal: []string{},
+		},
+		{
+			name:    "relation with no relations",
+			prop:    &notionapi.RelationProperty{},
+			wantOK:  true,
+			wantVal: []string{},
+		},
+		{
+			name:    "formula string",
+			prop:    &notionapi.FormulaProperty{Formula: notionapi.Formula{Type: "string", String: "computed"}},
+			wantOK:  true,
+			wantVal: "computed",
+		},
+		{
+			name:    "formula number",
+			prop:    &notionapi.FormulaProperty{Formula: notionapi.Formula{Type: "number", Number: 3.5}},
+			wantOK:  true,
+			wantVal: 3.5,
+		},
+		{
+			name:    "formula boolean",
+			prop:    &notionapi.FormulaProperty{Formula: notionapi.Formula{Type: "boolean", Boolean: true}},
+			wantOK:  true,
+			wantVal: true,
+		},
+		{
+			name:    "formula unsupported type",
+			prop:    &notionapi.FormulaProperty{Formula: notionapi.Formula{Type: "unknown"}},
+			wantOK:  false,
+		},
+		{
+			name:    "rollup number",
+			prop:    &notionapi.RollupProperty{Rollup: notionapi.Rollup{Type: "number", Number: 7}},
+			wantOK:  true,
+			wantVal: float64(7),
+		},
+		{
+			name: "rollup array",
+			prop: &notionapi.RollupProperty{Rollup: notionapi.Rollup{
+				Type:  "array",
+				Array: []notionapi.Property{&notionapi.NumberProperty{Number: 1}, &notionapi.CheckboxProperty{Checkbox: false}},
+			}},
+			wantOK:  true,
+			wantVal: []interface{}{float64(1), false},
+		},
+		{
+			name:   "unsupported property type",
+			prop:   nil,
+			wantOK: false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, ok := propertyValue(tc.prop)
+			if ok != tc.wantOK {
+				t.Fatalf("propertyValue(%v) ok = %v, want %v", tc.prop, ok, tc.wantOK)
+			}
+			if ok && !reflect.DeepEqual(got, tc.wantVal) {
+				t.Errorf("propertyValue(%v) = %v, want %v", tc.prop, got, tc.wantVal)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"context"
+)
+
+const (
+	defaultNotionRPS        = 3
+	defaultNotionConcurrent = 4
+	defaultNotionMaxRetries = 5
+)
+
+// semaphore bounds the number of in-flight Notion API calls.
+type semaphore chan struct{}
+
+func newSemaphore(n int) semaphore {
+	if n < 1 {
+		n = 1
+	}
+	return make(semaphore, n)
+}
+
+func (s semaphore) acquire() { s <- struct{}{} }
+func (s semaphore) release() { <-s }
+
+// withRateLimit waits for a token from the shared limiter and a free slot in
+// the worker pool before invoking fn. Retrying on HTTP 429 is handled by the
+// notionapi client itself (see NewNotionClient's notionapi.WithRetry option),
+// which already honors Notion's Retry-After header, so callers here don't
+// need to detect or back off from rate-limit errors themselves.
+func (c *NotionClient) withRateLimit(ctx context.Context, fn func() error) error {
+	c.sem.acquire()
+	defer c.sem.release()
+
+	if err := c.limiter.Wait(ctx); err != nil {
+		return err
+	}
+	return fn()
+}
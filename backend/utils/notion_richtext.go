@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jomei/notionapi"
+)
+
+// PageSlugResolver resolves a Notion page ID to the slug it was imported
+// under, so `[[page]]` mentions in rich text can link to the right PandaWiki
+// page. It should return ok=false when the page hasn't been imported (yet),
+// in which case the mention falls back to the raw Notion page ID.
+type PageSlugResolver func(notionPageID string) (slug string, ok bool)
+
+// WithPageSlugResolver lets callers resolve page mentions to slugs once the
+// referenced pages have been imported.
+func WithPageSlugResolver(resolver PageSlugResolver) NotionClientOption {
+	return func(c *NotionClient) {
+		c.slugResolver = resolver
+	}
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	"`", "\\`",
+	"*", `\*`,
+	"_", `\_`,
+	"{", `\{`, "}", `\}`,
+	"[", `\[`, "]", `\]`,
+	"(", `\(`, ")", `\)`,
+	"#", `\#`,
+	"+", `\+`,
+	"-", `\-`,
+	".", `\.`,
+	"!", `\!`,
+	"|", `\|`,
+)
+
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+// richTextToMarkdown walks a run of Notion rich text and renders it to
+// markdown, preserving bold/italic/strikethrough/code, inline links,
+// mentions, and equations instead of flattening everything to plain text.
+func (c *NotionClient) richTextToMarkdown(rt []notionapi.RichText) string {
+	var buf strings.Builder
+	for _, r := range rt {
+		buf.WriteString(c.richTextRunToMarkdown(r))
+	}
+	return buf.String()
+}
+
+// richTextRunToMarkdown dispatches on which of Equation/Mention is populated
+// rather than on Type: the SDK only distinguishes rich text kinds by which
+// of these pointers is non-nil.
+func (c *NotionClient) richTextRunToMarkdown(r notionapi.RichText) string {
+	switch {
+	case r.Equation != nil:
+		return fmt.Sprintf("$%s$", r.Equation.Expression)
+	case r.Mention != nil:
+		return c.mentionToMarkdown(r)
+	default:
+		return formatRun(r)
+	}
+}
+
+// formatRun renders a plain-text rich text run, applying its annotations.
+// Code spans are left unescaped (markdown doesn't interpret characters
+// inside backticks); everything else is escaped first.
+func formatRun(r notionapi.RichText) string {
+	if r.Annotations != nil && r.Annotations.Code {
+		return "`" + r.PlainText + "`"
+	}
+
+	text := escapeMarkdown(r.PlainText)
+	if r.Annotations != nil {
+		if r.Annotations.Bold {
+			text = "**" + text + "**"
+		}
+		if r.Annotations.Italic {
+			text = "*" + text + "*"
+		}
+		if r.Annotations.Strikethrough {
+			text = "~~" + text + "~~"
+		}
+	}
+
+	href := r.Href
+	if href == "" && r.Text != nil && r.Text.Link != nil {
+		href = r.Text.Link.Url
+	}
+	if href != "" {
+		return fmt.Sprintf("[%s](%s)", text, href)
+	}
+	return text
+}
+
+// mentionToMarkdown renders a mention run. Callers must only invoke this when
+// r.Mention is non-nil.
+func (c *NotionClient) mentionToMarkdown(r notionapi.RichText) string {
+	switch r.Mention.Type {
+	case notionapi.MentionTypeUser:
+		return fmt.Sprintf("[@%s]", r.PlainText)
+	case notionapi.MentionTypePage:
+		id := ""
+		if r.Mention.Page != nil {
+			id = r.Mention.Page.ID.String()
+		}
+		if slug, ok := c.resolvePageSlug(id); ok {
+			return fmt.Sprintf("[[%s]]", slug)
+		}
+		return fmt.Sprintf("[[%s]]", id)
+	case notionapi.MentionTypeDatabase:
+		id := ""
+		if r.Mention.Database != nil {
+			id = r.Mention.Database.ID.String()
+		}
+		return fmt.Sprintf("[[%s]]", id)
+	case notionapi.MentionTypeDate:
+		if r.Mention.Date != nil {
+			return fmt.Sprintf("%s", r.Mention.Date.Start)
+		}
+		return escapeMarkdown(r.PlainText)
+	default:
+		return escapeMarkdown(r.PlainText)
+	}
+}
+
+func (c *NotionClient) resolvePageSlug(notionPageID string) (string, bool) {
+	if c.slugResolver == nil || notionPageID == "" {
+		return "", false
+	}
+	return c.slugResolver(notionPageID)
+}
@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/jomei/notionapi"
+)
+
+func TestFormatRun(t *testing.T) {
+	cases := []struct {
+		name string
+		in   notionapi.RichText
+		want string
+	}{
+		{
+			name: "plain",
+			in:   notionapi.RichText{PlainText: "hello"},
+			want: "hello",
+		},
+		{
+			name: "escapes markdown special characters",
+			in:   notionapi.RichText{PlainText: "a*b_c"},
+			want: `a\*b\_c`,
+		},
+		{
+			name: "bold",
+			in:   notionapi.RichText{PlainText: "hi", Annotations: &notionapi.Annotations{Bold: true}},
+			want: "**hi**",
+		},
+		{
+			name: "code is not escaped",
+			in:   notionapi.RichText{PlainText: "a*b", Annotations: &notionapi.Annotations{Code: true}},
+			want: "`a*b`",
+		},
+		{
+			name: "link via href",
+			in:   notionapi.RichText{PlainText: "docs", Href: "https://example.com"},
+			want: "[docs](https://example.com)",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := formatRun(tc.in); got != tc.want {
+				t.Errorf("formatRun(%+v) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRichTextRunToMarkdown(t *testing.T) {
+	c := &NotionClient{}
+
+	t.Run("equation run", func(t *testing.T) {
+		r := notionapi.RichText{
+			PlainText: "x+y",
+			Equation:  &notionapi.Equation{Expression: "x+y"},
+		}
+		if got, want := c.richTextRunToMarkdown(r), "$x+y$"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("mention run falls through to mentionToMarkdown", func(t *testing.T) {
+		r := notionapi.RichText{
+			PlainText: "Some Page",
+			Mention: &notionapi.Mention{
+				Type: notionapi.MentionTypePage,
+				Page: &notionapi.PageMention{ID: "page-id"},
+			},
+		}
+		if got, want := c.richTextRunToMarkdown(r), "[[page-id]]"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("plain run falls through to formatRun", func(t *testing.T) {
+		r := notionapi.RichText{PlainText: "plain"}
+		if got, want := c.richTextRunToMarkdown(r), "plain"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+}
+
+func TestMentionToMarkdown(t *testing.T) {
+	t.Run("page mention resolves through slugResolver", func(t *testing.T) {
+		c := &NotionClient{slugResolver: func(id string) (string, bool) {
+			if id == "known-id" {
+				return "known-slug", true
+			}
+			return "", false
+		}}
+		r := notionapi.RichText{
+			Mention: &notionapi.Mention{
+				Type: notionapi.MentionTypePage,
+				Page: &notionapi.PageMention{ID: "known-id"},
+			},
+		}
+		if got, want := c.mentionToMarkdown(r), "[[known-slug]]"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("page mention falls back to raw id when unresolved", func(t *testing.T) {
+		c := &NotionClient{}
+		r := notionapi.RichText{
+			Mention: &notionapi.Mention{
+				Type: notionapi.MentionTypePage,
+				Page: &notionapi.PageMention{ID: "unknown-id"},
+			},
+		}
+		if got, want := c.mentionToMarkdown(r), "[[unknown-id]]"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("user mention renders as [@name]", func(t *testing.T) {
+		c := &NotionClient{}
+		r := notionapi.RichText{
+			PlainText: "Alice",
+			Mention:   &notionapi.Mention{Type: notionapi.MentionTypeUser},
+		}
+		if got, want := c.mentionToMarkdown(r), "[@Alice]"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+}